@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/golang-jwt/jwt/v5"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// AuthOptions aggregates every way the unpacker can authenticate against a
+// Git remote. getAuth picks a mode automatically based on the repository URL
+// scheme and whichever options were populated.
+type AuthOptions struct {
+	User     string
+	Password string
+
+	SSH       SSHOptions
+	GitHubApp GitHubAppOptions
+}
+
+// SSHOptions configures key-based authentication for git@/ssh:// remotes.
+type SSHOptions struct {
+	PrivateKeyFile string
+	Passphrase     string
+	KnownHostsFile string
+	// InsecureIgnoreHostKey disables host key verification. Intended for local
+	// testing only.
+	InsecureIgnoreHostKey bool
+}
+
+// GitHubAppOptions configures GitHub App installation-token authentication.
+type GitHubAppOptions struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKeyFile string
+}
+
+func (o GitHubAppOptions) empty() bool {
+	return o.AppID == 0 || o.InstallationID == 0 || o.PrivateKeyFile == ""
+}
+
+// getAuth selects and builds the transport.AuthMethod for gitRepository based
+// on its scheme and the populated fields of opts: SSH for git@/ssh:// URLs,
+// a GitHub App installation token when app credentials are supplied, plain
+// basic auth when a password is set, and no authentication (nil) otherwise.
+func getAuth(gitRepository string, opts AuthOptions) (transport.AuthMethod, error) {
+	if isSSHURL(gitRepository) {
+		return sshAuth(opts.SSH)
+	}
+
+	if !opts.GitHubApp.empty() {
+		token, err := githubAppInstallationToken(opts.GitHubApp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mint GitHub App installation token: %w", err)
+		}
+
+		return &githttp.BasicAuth{
+			Username: "x-access-token",
+			Password: token,
+		}, nil
+	}
+
+	if opts.Password != "" {
+		username := opts.User
+		if username == "" {
+			username = "token"
+		}
+
+		return &githttp.BasicAuth{
+			Username: username,
+			Password: opts.Password,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func isSSHURL(gitRepository string) bool {
+	return strings.HasPrefix(gitRepository, "git@") || strings.HasPrefix(gitRepository, "ssh://")
+}
+
+func sshAuth(opts SSHOptions) (transport.AuthMethod, error) {
+	if opts.PrivateKeyFile == "" {
+		return nil, fmt.Errorf("an SSH private key file is required to clone via SSH")
+	}
+
+	auth, err := ssh.NewPublicKeysFromFile("git", opts.PrivateKeyFile, opts.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH private key: %w", err)
+	}
+
+	switch {
+	case opts.InsecureIgnoreHostKey:
+		auth.HostKeyCallback = gossh.InsecureIgnoreHostKey()
+	case opts.KnownHostsFile != "":
+		callback, err := ssh.NewKnownHostsCallback(opts.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts file: %w", err)
+		}
+		auth.HostKeyCallback = callback
+	}
+
+	return auth, nil
+}
+
+// githubAppJWTTTL is kept well under GitHub's 10 minute limit for App JWTs.
+const githubAppJWTTTL = 9 * time.Minute
+
+// githubAppTokenRefreshMargin is how far ahead of an installation token's
+// reported expiry a cached token is considered stale, so a long-running poll
+// (e.g. WatchCommand) never hands out a token that expires mid-clone.
+const githubAppTokenRefreshMargin = 1 * time.Minute
+
+// githubAppTokenCache holds the last installation token minted for a given
+// app/installation pair, keyed by githubAppCacheKey, so a watch loop polling
+// every few seconds doesn't mint a fresh token and round-trip to
+// api.github.com on every single poll.
+type githubAppTokenCache struct {
+	token     string
+	expiresAt time.Time
+}
+
+type githubAppCacheKey struct {
+	appID          int64
+	installationID int64
+}
+
+var (
+	githubAppTokenCacheMu sync.Mutex
+	githubAppTokenCaches  = map[githubAppCacheKey]githubAppTokenCache{}
+)
+
+// githubAppTokenFresh reports whether a cached token expiring at expiresAt is
+// still usable as of now, i.e. not within githubAppTokenRefreshMargin of
+// expiry.
+func githubAppTokenFresh(expiresAt, now time.Time) bool {
+	return now.Add(githubAppTokenRefreshMargin).Before(expiresAt)
+}
+
+// githubAppInstallationToken exchanges a GitHub App's ID, installation ID and
+// private key for a short-lived installation access token, used as the
+// password half of a basic-auth clone/fetch. The token is cached in-process
+// per app/installation and only re-minted once it is within
+// githubAppTokenRefreshMargin of the expiry GitHub reported for it.
+func githubAppInstallationToken(opts GitHubAppOptions) (string, error) {
+	cacheKey := githubAppCacheKey{appID: opts.AppID, installationID: opts.InstallationID}
+
+	githubAppTokenCacheMu.Lock()
+	cached, ok := githubAppTokenCaches[cacheKey]
+	githubAppTokenCacheMu.Unlock()
+	if ok && githubAppTokenFresh(cached.expiresAt, time.Now()) {
+		return cached.token, nil
+	}
+
+	keyData, err := os.ReadFile(opts.PrivateKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+
+	appJWT, err := signGitHubAppJWT(opts.AppID, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", opts.InstallationID)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+appJWT)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request installation token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("unexpected status %d minting installation token", resp.StatusCode)
+	}
+
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode installation token response: %w", err)
+	}
+
+	githubAppTokenCacheMu.Lock()
+	githubAppTokenCaches[cacheKey] = githubAppTokenCache{token: body.Token, expiresAt: body.ExpiresAt}
+	githubAppTokenCacheMu.Unlock()
+
+	return body.Token, nil
+}
+
+func signGitHubAppJWT(appID int64, privateKey *rsa.PrivateKey) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    fmt.Sprintf("%d", appID),
+		IssuedAt:  jwt.NewNumericDate(now.Add(-30 * time.Second)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(githubAppJWTTTL)),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return token.SignedString(privateKey)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGitHubAppTokenFresh(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      bool
+	}{
+		{"well before expiry", now.Add(10 * time.Minute), true},
+		{"inside refresh margin", now.Add(30 * time.Second), false},
+		{"already expired", now.Add(-time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		if got := githubAppTokenFresh(tt.expiresAt, now); got != tt.want {
+			t.Errorf("%s: githubAppTokenFresh() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsSSHURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"git@github.com:portainer/portainer.git", true},
+		{"ssh://git@github.com/portainer/portainer.git", true},
+		{"https://github.com/portainer/portainer.git", false},
+		{"http://github.com/portainer/portainer.git", false},
+	}
+
+	for _, tt := range tests {
+		if got := isSSHURL(tt.url); got != tt.want {
+			t.Errorf("isSSHURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package metrics exposes Prometheus instrumentation for the unpacker's
+// clone and Compose deploy operations so operators can track stack
+// redeploys across Portainer instances.
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Clone failure cause labels. These are kept stable across releases since
+// dashboards and alerts key off them.
+const (
+	CauseAuthFailure     = "auth_failure"
+	CauseRepoNotFound    = "repo_not_found"
+	CauseNetwork         = "network"
+	CauseContextCanceled = "context_cancel"
+	CauseUnknown         = "unknown"
+)
+
+var (
+	CloneAttemptsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "compose_unpacker",
+		Name:      "clone_attempts_total",
+		Help:      "Total number of Git clone attempts.",
+	})
+
+	CloneFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "compose_unpacker",
+		Name:      "clone_failures_total",
+		Help:      "Total number of Git clone and fetch failures, labeled by cause.",
+	}, []string{"cause"})
+
+	DeployAttemptsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "compose_unpacker",
+		Name:      "deploy_attempts_total",
+		Help:      "Total number of Compose stack deploy attempts.",
+	})
+
+	DeployFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "compose_unpacker",
+		Name:      "deploy_failures_total",
+		Help:      "Total number of Compose stack deploy failures.",
+	})
+
+	DeployDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "compose_unpacker",
+		Name:      "deploy_duration_seconds",
+		Help:      "Duration of a stack deploy run, in seconds: clone+deploy for deploy, fetch+deploy for update, the Compose deploy step alone for watch.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// Registry is the registry instrumented commands publish to, and the one
+// served over the optional --metrics-addr HTTP listener.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		CloneAttemptsTotal,
+		CloneFailuresTotal,
+		DeployAttemptsTotal,
+		DeployFailuresTotal,
+		DeployDurationSeconds,
+	)
+}
+
+// ClassifyCloneError maps a go-git/transport error into one of the stable
+// cause labels used by CloneFailuresTotal.
+func ClassifyCloneError(err error) string {
+	switch {
+	case errors.Is(err, transport.ErrAuthenticationRequired):
+		return CauseAuthFailure
+	case errors.Is(err, transport.ErrAuthorizationFailed):
+		return CauseAuthFailure
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return CauseRepoNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return CauseContextCanceled
+	case errors.Is(err, context.Canceled):
+		return CauseContextCanceled
+	default:
+		return CauseNetwork
+	}
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestClassifyCloneError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"auth required", transport.ErrAuthenticationRequired, CauseAuthFailure},
+		{"auth failed", transport.ErrAuthorizationFailed, CauseAuthFailure},
+		{"repo not found", transport.ErrRepositoryNotFound, CauseRepoNotFound},
+		{"context cancelled", context.Canceled, CauseContextCanceled},
+		{"context deadline exceeded", context.DeadlineExceeded, CauseContextCanceled},
+		{"wrapped auth error", fmt.Errorf("failed to clone: %w", transport.ErrAuthenticationRequired), CauseAuthFailure},
+		{"unknown", errors.New("connection reset"), CauseNetwork},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyCloneError(tt.err); got != tt.want {
+			t.Errorf("%s: ClassifyCloneError() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileProvider resolves variables from a local `KEY=value` env file, e.g. one
+// mounted into the unpacker's container out of band.
+type FileProvider struct {
+	Path string
+}
+
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{Path: path}
+}
+
+func (p *FileProvider) Resolve(ctx context.Context, keys []string) (map[string]string, error) {
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secrets file %q: %w", p.Path, err)
+	}
+	defer f.Close()
+
+	available := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		available[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read secrets file %q: %w", p.Path, err)
+	}
+
+	resolved := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if v, ok := available[key]; ok {
+			resolved[key] = v
+		}
+	}
+
+	return resolved, nil
+}
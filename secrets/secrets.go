@@ -0,0 +1,13 @@
+// Package secrets resolves compose variable references against a pluggable
+// backend, so stack manifests in Git can reference credentials without
+// committing them.
+package secrets
+
+import "context"
+
+// Provider resolves a set of variable names to their values. Implementations
+// should return only the keys they could find; callers decide how to handle
+// keys left unresolved.
+type Provider interface {
+	Resolve(ctx context.Context, keys []string) (map[string]string, error)
+}
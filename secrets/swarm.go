@@ -0,0 +1,39 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SwarmProvider resolves variables from Docker Swarm secrets mounted at
+// /run/secrets, reading the mounted secret whose filename is exactly the key.
+// The match is case-sensitive.
+type SwarmProvider struct {
+	SecretsDir string
+}
+
+func NewSwarmProvider(secretsDir string) *SwarmProvider {
+	if secretsDir == "" {
+		secretsDir = "/run/secrets"
+	}
+	return &SwarmProvider{SecretsDir: secretsDir}
+}
+
+func (p *SwarmProvider) Resolve(ctx context.Context, keys []string) (map[string]string, error) {
+	resolved := make(map[string]string, len(keys))
+	for _, key := range keys {
+		data, err := os.ReadFile(filepath.Join(p.SecretsDir, key))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read Swarm secret %q: %w", key, err)
+		}
+		resolved[key] = strings.TrimRight(string(data), "\n")
+	}
+
+	return resolved, nil
+}
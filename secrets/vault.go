@@ -0,0 +1,42 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// VaultProvider resolves variables from a single HashiCorp Vault KV v2
+// secret, keyed by field name within that secret.
+type VaultProvider struct {
+	Client     *vaultapi.Client
+	MountPath  string
+	SecretPath string
+}
+
+func NewVaultProvider(client *vaultapi.Client, mountPath, secretPath string) *VaultProvider {
+	return &VaultProvider{Client: client, MountPath: mountPath, SecretPath: secretPath}
+}
+
+func (p *VaultProvider) Resolve(ctx context.Context, keys []string) (map[string]string, error) {
+	secret, err := p.Client.KVv2(p.MountPath).Get(ctx, p.SecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault secret %q/%q: %w", p.MountPath, p.SecretPath, err)
+	}
+
+	resolved := make(map[string]string, len(keys))
+	for _, key := range keys {
+		raw, ok := secret.Data[key]
+		if !ok {
+			continue
+		}
+		value, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("vault field %q is not a string", key)
+		}
+		resolved[key] = value
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/sled/compose-unpacker/secrets"
+)
+
+// SecretsOptions configures how compose variable references are resolved
+// before deploy. When Backend is empty, no resolution is attempted and
+// deploy behaves exactly as it did before secrets support existed.
+type SecretsOptions struct {
+	// Backend selects the provider: "file", "vault", or "swarm".
+	Backend string
+	// Path is backend-specific: a file path for "file", a "mount/secret"
+	// path for "vault", or the secrets directory for "swarm" (defaults to
+	// /run/secrets when empty).
+	Path string
+	// KeyMapping renames a compose variable to a different backend key,
+	// e.g. {"DB_PASSWORD": "prod/db-password"}. Variables absent from this
+	// map are looked up under their own name.
+	KeyMapping map[string]string
+}
+
+func (o SecretsOptions) empty() bool {
+	return o.Backend == ""
+}
+
+var composeVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?:[:-][^}]*)?\}`)
+
+// collectComposeVariables scans the given compose files for ${VAR} and
+// ${VAR:-default} style references and returns the unique variable names
+// found, sorted for deterministic output.
+func collectComposeVariables(composeFilePaths []string) ([]string, error) {
+	seen := map[string]struct{}{}
+	for _, p := range composeFilePaths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compose file %q: %w", p, err)
+		}
+		for _, match := range composeVarPattern.FindAllStringSubmatch(string(data), -1) {
+			seen[match[1]] = struct{}{}
+		}
+	}
+
+	variables := make([]string, 0, len(seen))
+	for v := range seen {
+		variables = append(variables, v)
+	}
+	sort.Strings(variables)
+
+	return variables, nil
+}
+
+func newSecretsProvider(opts SecretsOptions) (secrets.Provider, error) {
+	switch opts.Backend {
+	case "file":
+		return secrets.NewFileProvider(opts.Path), nil
+	case "vault":
+		mountPath, secretPath, err := splitVaultPath(opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Vault client: %w", err)
+		}
+		return secrets.NewVaultProvider(client, mountPath, secretPath), nil
+	case "swarm":
+		return secrets.NewSwarmProvider(opts.Path), nil
+	default:
+		return nil, fmt.Errorf("unsupported secrets backend %q", opts.Backend)
+	}
+}
+
+// splitVaultPath splits a "--secrets-path" value into the KV v2 mount and the
+// secret path within it. The mount is always the first path segment (e.g.
+// "secret"); everything after it, however many segments deep, is the secret
+// path passed to KVv2.Get (e.g. "myapp/prod/db").
+func splitVaultPath(path string) (mountPath, secretPath string, err error) {
+	i := strings.Index(path, "/")
+	if i <= 0 || i == len(path)-1 {
+		return "", "", fmt.Errorf("vault secrets path %q must be of the form <mount>/<secret>", path)
+	}
+	return path[:i], path[i+1:], nil
+}
+
+// renderSecretsEnvFile resolves every ${VAR} reference found in
+// composeFilePaths through the configured secrets backend and writes the
+// result as a `KEY=value` env file inside clonePath, returning its path.
+// It returns an empty path when opts is unset, so deploy falls back to its
+// existing no-env-file behavior.
+func renderSecretsEnvFile(cmdCtx *CommandExecutionContext, clonePath string, composeFilePaths []string, opts SecretsOptions) (string, error) {
+	if opts.empty() {
+		return "", nil
+	}
+
+	variables, err := collectComposeVariables(composeFilePaths)
+	if err != nil {
+		return "", err
+	}
+	if len(variables) == 0 {
+		return "", nil
+	}
+
+	backendKeys := make([]string, len(variables))
+	varToBackendKey := make(map[string]string, len(variables))
+	for i, v := range variables {
+		backendKey := v
+		if mapped, ok := opts.KeyMapping[v]; ok {
+			backendKey = mapped
+		}
+		backendKeys[i] = backendKey
+		varToBackendKey[v] = backendKey
+	}
+
+	provider, err := newSecretsProvider(opts)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := provider.Resolve(cmdCtx.context, backendKeys)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	envFilePath := filepath.Join(clonePath, ".unpacker.env")
+	f, err := os.OpenFile(envFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create secrets env file: %w", err)
+	}
+	defer f.Close()
+
+	for _, v := range variables {
+		value, ok := resolved[varToBackendKey[v]]
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintf(f, "%s=%s\n", v, value); err != nil {
+			return "", fmt.Errorf("failed to write secrets env file: %w", err)
+		}
+	}
+
+	cmdCtx.logger.Infow("Rendered secrets env file",
+		"path", envFilePath,
+		"variables", variables,
+		"resolved", len(resolved),
+	)
+
+	return envFilePath, nil
+}
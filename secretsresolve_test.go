@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitVaultPath(t *testing.T) {
+	tests := []struct {
+		path       string
+		mountPath  string
+		secretPath string
+		wantErr    bool
+	}{
+		{path: "secret/myapp/prod/db", mountPath: "secret", secretPath: "myapp/prod/db"},
+		{path: "secret/db", mountPath: "secret", secretPath: "db"},
+		{path: "secret", wantErr: true},
+		{path: "/db", wantErr: true},
+		{path: "secret/", wantErr: true},
+		{path: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		mountPath, secretPath, err := splitVaultPath(tt.path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitVaultPath(%q): expected error, got none", tt.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitVaultPath(%q): unexpected error: %v", tt.path, err)
+			continue
+		}
+		if mountPath != tt.mountPath || secretPath != tt.secretPath {
+			t.Errorf("splitVaultPath(%q) = (%q, %q), want (%q, %q)", tt.path, mountPath, secretPath, tt.mountPath, tt.secretPath)
+		}
+	}
+}
+
+func TestCollectComposeVariables(t *testing.T) {
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "docker-compose.yml")
+	content := []byte(`
+services:
+  app:
+    image: myapp
+    environment:
+      DB_PASSWORD: ${DB_PASSWORD}
+      DB_HOST: ${DB_HOST:-localhost}
+      API_KEY: ${API_KEY}
+`)
+	if err := os.WriteFile(composePath, content, 0644); err != nil {
+		t.Fatalf("failed to write fixture compose file: %v", err)
+	}
+
+	got, err := collectComposeVariables([]string{composePath})
+	if err != nil {
+		t.Fatalf("collectComposeVariables returned error: %v", err)
+	}
+
+	want := []string{"API_KEY", "DB_HOST", "DB_PASSWORD"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectComposeVariables() = %v, want %v", got, want)
+	}
+}
+
+func TestCollectComposeVariablesMissingFile(t *testing.T) {
+	if _, err := collectComposeVariables([]string{"/nonexistent/docker-compose.yml"}); err == nil {
+		t.Error("expected an error for a missing compose file, got none")
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/portainer/docker-compose-wrapper/compose"
+	"github.com/portainer/portainer/api/filesystem"
+	"github.com/sled/compose-unpacker/metrics"
+)
+
+// prepareDestination backs up any existing directory at destination and
+// ensures an empty one is ready for a fresh clone. When a backup was made,
+// it returns a cleanup function the caller should defer to remove it once
+// the new clone+deploy has finished.
+func prepareDestination(cmdCtx *CommandExecutionContext, destination string) (cleanup func(), err error) {
+	cmdCtx.logger.Infow("Checking the file system...",
+		"directory", destination,
+	)
+
+	if _, err := os.Stat(destination); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		cmdCtx.logger.Infow("Creating folder in the file system...",
+			"directory", destination,
+		)
+		if err := os.MkdirAll(destination, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create destination directory: %w", err)
+		}
+
+		return func() {}, nil
+	}
+
+	cmdCtx.logger.Infow("Backing up folder in the file system...",
+		"directory", destination,
+	)
+	backupProjectPath := fmt.Sprintf("%s-old", destination)
+	if err := filesystem.MoveDirectory(destination, backupProjectPath); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := os.RemoveAll(backupProjectPath); err != nil {
+			log.Printf("[WARN] [http,stacks,git] [error: %s] [message: unable to remove git repository directory]", err)
+		}
+	}, nil
+}
+
+// stackOptions collects the clone/auth/compose parameters shared by
+// DeployCommand, UpdateCommand and WatchCommand so the three can drive the
+// same clone/fetch/deploy helpers instead of duplicating them.
+type stackOptions struct {
+	GitRepository            string
+	Destination              string
+	ComposeRelativeFilePaths []string
+	ProjectName              string
+	Reference                string
+	Commit                   string
+	Auth                     AuthOptions
+	TLS                      TLSOptions
+	Secrets                  SecretsOptions
+	Sparse                   SparseOptions
+	RecurseSubmodules        bool
+}
+
+// SparseOptions configures a partial clone for monorepos that hold many
+// stacks, so only the directories a given stack actually needs are checked
+// out to disk.
+type SparseOptions struct {
+	// Enabled performs a NoCheckout clone and then sparse-checks-out only the
+	// directories containing the requested compose files plus IncludePaths.
+	Enabled bool
+	// IncludePaths are additional repository-relative directories to check
+	// out alongside the compose files' own directories, e.g. a shared .env
+	// or base compose fragment living elsewhere in the monorepo.
+	IncludePaths []string
+}
+
+func repositoryNameFromURL(gitRepository string) (string, error) {
+	i := strings.LastIndex(gitRepository, "/")
+	if i == -1 {
+		return "", fmt.Errorf("invalid Git repository URL %q", gitRepository)
+	}
+	return strings.TrimSuffix(gitRepository[i+1:], ".git"), nil
+}
+
+// joinClonePath mirrors the layout DeployCommand clones into, so
+// UpdateCommand and WatchCommand can find a clone made by an earlier Deploy
+// run without re-deriving the path differently.
+func joinClonePath(destination, repositoryName string) string {
+	return path.Join(destination, repositoryName)
+}
+
+// clone backs up any existing destination directory, clones opts.GitRepository
+// into it, and checks out opts.Commit when pinned. It is the shared first step
+// of DeployCommand and WatchCommand's initial deploy.
+func clone(cmdCtx *CommandExecutionContext, opts stackOptions) (clonePath string, repository *git.Repository, cleanup func(), err error) {
+	if err := installTLSTransport(opts.TLS); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to configure Git TLS transport: %w", err)
+	}
+
+	repositoryName, err := repositoryNameFromURL(opts.GitRepository)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	cleanup, err = prepareDestination(cmdCtx, opts.Destination)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	auth, err := getAuth(opts.GitRepository, opts.Auth)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to build Git authentication: %w", err)
+	}
+
+	gitOptions := git.CloneOptions{
+		URL:  opts.GitRepository,
+		Auth: auth,
+		// A Depth-1 clone only contains the tip commit's objects, which isn't
+		// enough to check out an arbitrary pinned Commit (e.g. rolling back to
+		// an older commit on the same branch). Fetch full history whenever a
+		// commit is pinned, and stay shallow otherwise.
+		Depth: 1,
+	}
+	if opts.Commit != "" {
+		gitOptions.Depth = 0
+	}
+	if opts.Reference != "" {
+		gitOptions.ReferenceName = plumbing.ReferenceName(opts.Reference)
+		gitOptions.SingleBranch = true
+	}
+	if opts.Sparse.Enabled {
+		gitOptions.NoCheckout = true
+	}
+
+	clonePath = joinClonePath(opts.Destination, repositoryName)
+
+	cmdCtx.logger.Infow("Cloning git repository",
+		"path", clonePath,
+		"cloneOptions", gitOptions,
+	)
+
+	metrics.CloneAttemptsTotal.Inc()
+	repository, err = git.PlainCloneContext(cmdCtx.context, clonePath, false, &gitOptions)
+	if err != nil {
+		cause := metrics.ClassifyCloneError(err)
+		metrics.CloneFailuresTotal.WithLabelValues(cause).Inc()
+		return "", nil, nil, fmt.Errorf("failed to clone Git repository (cause=%s): %w", cause, err)
+	}
+
+	if opts.Sparse.Enabled {
+		cmdCtx.logger.Infow("Performing sparse checkout",
+			"composePaths", opts.ComposeRelativeFilePaths,
+			"includePaths", opts.Sparse.IncludePaths,
+		)
+		if err := sparseCheckout(repository, opts); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to perform sparse checkout: %w", err)
+		}
+	} else if opts.Commit != "" {
+		cmdCtx.logger.Infow("Checking out pinned commit",
+			"commit", opts.Commit,
+		)
+		if err := checkoutCommit(repository, opts.Commit); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to checkout pinned commit: %w", err)
+		}
+	}
+
+	if opts.RecurseSubmodules {
+		cmdCtx.logger.Infow("Updating submodules",
+			"path", clonePath,
+		)
+		if err := updateSubmodules(repository); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to update submodules: %w", err)
+		}
+	}
+
+	return clonePath, repository, cleanup, nil
+}
+
+// sparseCheckout checks out only the directories containing opts'
+// ComposeRelativeFilePaths plus its Sparse.IncludePaths, at opts.Commit when
+// pinned or HEAD otherwise.
+func sparseCheckout(repository *git.Repository, opts stackOptions) error {
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+
+	checkoutOptions := git.CheckoutOptions{
+		SparseCheckoutDirectories: sparseCheckoutDirs(opts.ComposeRelativeFilePaths, opts.Sparse.IncludePaths),
+	}
+	if opts.Commit != "" {
+		checkoutOptions.Hash = plumbing.NewHash(opts.Commit)
+	}
+
+	return worktree.Checkout(&checkoutOptions)
+}
+
+// sparseCheckoutDirs computes the deduplicated set of repository-relative
+// directories a sparse checkout needs: the directory containing each compose
+// file plus any explicitly requested includePaths.
+func sparseCheckoutDirs(composeRelativeFilePaths, includePaths []string) []string {
+	dirs := map[string]struct{}{}
+	for _, composePath := range composeRelativeFilePaths {
+		dirs[path.Dir(composePath)] = struct{}{}
+	}
+	for _, includePath := range includePaths {
+		dirs[includePath] = struct{}{}
+	}
+
+	sparseDirs := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sparseDirs = append(sparseDirs, dir)
+	}
+
+	return sparseDirs
+}
+
+// updateSubmodules initializes and updates every submodule registered in the
+// repository's .gitmodules, for stacks that reference vendored config repos.
+func updateSubmodules(repository *git.Repository) error {
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return err
+	}
+
+	return submodules.Update(&git.SubmoduleUpdateOptions{
+		Init:              true,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+	})
+}
+
+// fetch fetches opts.GitRepository's remote into an already-cloned
+// repository and resets the worktree to the requested reference or commit
+// (HEAD's current branch when neither is set). It returns the resulting
+// commit hash so callers can detect whether anything changed.
+func fetch(cmdCtx *CommandExecutionContext, repository *git.Repository, opts stackOptions) (plumbing.Hash, error) {
+	auth, err := getAuth(opts.GitRepository, opts.Auth)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to build Git authentication: %w", err)
+	}
+
+	fetchOptions := git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+		Force:      true,
+		Tags:       git.AllTags,
+	}
+
+	err = repository.FetchContext(cmdCtx.context, &fetchOptions)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		cause := metrics.ClassifyCloneError(err)
+		metrics.CloneFailuresTotal.WithLabelValues(cause).Inc()
+		return plumbing.ZeroHash, fmt.Errorf("failed to fetch Git repository (cause=%s): %w", cause, err)
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to access repository worktree: %w", err)
+	}
+
+	previousHead, err := repository.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	hash, err := resolveFetchTarget(repository, opts)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	checkoutOptions := git.CheckoutOptions{Hash: hash, Force: true}
+	if opts.Sparse.Enabled {
+		checkoutOptions.SparseCheckoutDirectories = sparseCheckoutDirs(opts.ComposeRelativeFilePaths, opts.Sparse.IncludePaths)
+	}
+	if err := worktree.Checkout(&checkoutOptions); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to checkout requested revision: %w", err)
+	}
+
+	if opts.RecurseSubmodules && hash != previousHead.Hash() {
+		cmdCtx.logger.Infow("Updating submodules",
+			"commit", hash.String(),
+		)
+		if err := updateSubmodules(repository); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to update submodules: %w", err)
+		}
+	}
+
+	return hash, nil
+}
+
+// resolveFetchTarget determines which commit a post-fetch worktree should be
+// reset to: the pinned commit, the pinned reference, or the remote tip of
+// whatever branch is currently checked out.
+func resolveFetchTarget(repository *git.Repository, opts stackOptions) (plumbing.Hash, error) {
+	if opts.Commit != "" {
+		return plumbing.NewHash(opts.Commit), nil
+	}
+
+	if opts.Reference != "" {
+		return resolveRemoteReference(repository, opts.Reference)
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	return resolveRemoteReference(repository, head.Name().String())
+}
+
+// resolveRemoteReference resolves a branch or tag reference to the commit it
+// points to as of the last fetch from "origin". Tags are looked up directly
+// since fetch brings them in under refs/tags/*; branches are looked up under
+// the refs/remotes/origin/* remote-tracking refs the clone's default refspec
+// maintains, since a plain fetch never moves the local branch ref itself.
+func resolveRemoteReference(repository *git.Repository, reference string) (plumbing.Hash, error) {
+	if strings.HasPrefix(reference, "refs/tags/") {
+		ref, err := repository.Reference(plumbing.ReferenceName(reference), true)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to resolve tag %q: %w", reference, err)
+		}
+		return ref.Hash(), nil
+	}
+
+	branch := strings.TrimPrefix(reference, "refs/heads/")
+	ref, err := repository.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve branch %q: %w", reference, err)
+	}
+
+	return ref.Hash(), nil
+}
+
+// deploy runs the Compose deployer against an already-checked-out clone.
+func deploy(cmdCtx *CommandExecutionContext, clonePath string, opts stackOptions) error {
+	cmdCtx.logger.Infow("Creating Compose deployer",
+		"binPath", BIN_PATH,
+	)
+
+	deployer, err := compose.NewComposeDeployer(BIN_PATH, "")
+	if err != nil {
+		return fmt.Errorf("failed to create Compose deployer: %w", err)
+	}
+
+	composeFilePaths := make([]string, len(opts.ComposeRelativeFilePaths))
+	for i := 0; i < len(opts.ComposeRelativeFilePaths); i++ {
+		composeFilePaths[i] = path.Join(clonePath, opts.ComposeRelativeFilePaths[i])
+	}
+
+	envFilePath, err := renderSecretsEnvFile(cmdCtx, clonePath, composeFilePaths, opts.Secrets)
+	if err != nil {
+		return fmt.Errorf("failed to render secrets env file: %w", err)
+	}
+
+	cmdCtx.logger.Infow("Deploying Compose stack",
+		"composeFilePaths", composeFilePaths,
+		"workingDirectory", clonePath,
+		"projectName", opts.ProjectName,
+	)
+
+	metrics.DeployAttemptsTotal.Inc()
+	err = deployer.Deploy(cmdCtx.context, clonePath, "", opts.ProjectName, composeFilePaths, envFilePath, false)
+	if err != nil {
+		metrics.DeployFailuresTotal.Inc()
+		return fmt.Errorf("failed to deploy Compose stack: %w", err)
+	}
+
+	return nil
+}
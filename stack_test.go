@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSparseCheckoutDirs(t *testing.T) {
+	tests := []struct {
+		name                     string
+		composeRelativeFilePaths []string
+		includePaths             []string
+		want                     []string
+	}{
+		{
+			name:                     "single compose file",
+			composeRelativeFilePaths: []string{"stacks/app/docker-compose.yml"},
+			want:                     []string{"stacks/app"},
+		},
+		{
+			name:                     "dedupes compose files in the same directory",
+			composeRelativeFilePaths: []string{"stacks/app/docker-compose.yml", "stacks/app/docker-compose.override.yml"},
+			want:                     []string{"stacks/app"},
+		},
+		{
+			name:                     "adds include paths",
+			composeRelativeFilePaths: []string{"stacks/app/docker-compose.yml"},
+			includePaths:             []string{"shared/base"},
+			want:                     []string{"shared/base", "stacks/app"},
+		},
+		{
+			name:                     "dedupes overlapping include path",
+			composeRelativeFilePaths: []string{"stacks/app/docker-compose.yml"},
+			includePaths:             []string{"stacks/app"},
+			want:                     []string{"stacks/app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sparseCheckoutDirs(tt.composeRelativeFilePaths, tt.includePaths)
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("sparseCheckoutDirs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("sparseCheckoutDirs() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// TLSOptions configures how the unpacker's Git clients trust the remote
+// server, for self-signed or enterprise-internal GitLab/Gitea/GitHub
+// Enterprise instances.
+type TLSOptions struct {
+	// CAFile is a path to a PEM-encoded CA bundle to trust in addition to the
+	// system trust store.
+	CAFile string
+	// TLSCert and TLSKey are paths to a PEM-encoded client certificate/key pair
+	// used for mTLS.
+	TLSCert string
+	TLSKey  string
+	// InsecureSkipTLSVerify disables server certificate verification entirely.
+	// Intended for local testing only.
+	InsecureSkipTLSVerify bool
+}
+
+// empty reports whether none of the TLS options were set, meaning go-git's
+// default HTTPS transport can be used unmodified.
+func (o TLSOptions) empty() bool {
+	return o.CAFile == "" && o.TLSCert == "" && o.TLSKey == "" && !o.InsecureSkipTLSVerify
+}
+
+// installTLSTransport builds an *http.Client honoring the given TLS options
+// and registers it as go-git's transport for the "https" protocol, so that
+// subsequent PlainCloneContext/FetchContext calls pick it up.
+func installTLSTransport(opts TLSOptions) error {
+	if opts.empty() {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipTLSVerify,
+	}
+
+	if opts.CAFile != "" {
+		caCert, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("failed to parse CA file %q", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.TLSCert != "" && opts.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate/key pair: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	customClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	client.InstallProtocol("https", githttp.NewClient(customClient))
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// BIN_PATH is the location of the docker-compose binary inside the unpacker image.
+const BIN_PATH = "/usr/local/bin/docker-compose"
+
+// CommandExecutionContext carries the request-scoped context and logger shared
+// across the unpacker's commands.
+type CommandExecutionContext struct {
+	context context.Context
+	logger  *zap.SugaredLogger
+}
+
+// DeployCommand clones a Git repository containing one or more Compose files
+// and deploys them as a stack.
+type DeployCommand struct {
+	GitRepository            string
+	User                     string
+	Password                 string
+	Destination              string
+	ComposeRelativeFilePaths []string
+	ProjectName              string
+
+	// Reference pins the clone to a specific branch or tag, e.g. "refs/heads/prod"
+	// or "refs/tags/v1.2.3". When empty, the remote's default branch is used.
+	Reference string
+	// Commit pins the clone to a specific commit SHA. When set, it is checked out
+	// after the initial clone, overriding whatever Reference resolved to.
+	Commit string
+
+	// MetricsAddr, when non-empty, starts an HTTP listener serving Prometheus
+	// metrics for the duration of the command (e.g. "127.0.0.1:9090").
+	MetricsAddr string
+
+	// TLS configures trust for on-prem/self-signed Git servers.
+	TLS TLSOptions
+
+	// SSH configures key-based authentication, used automatically when
+	// GitRepository is a git@/ssh:// URL.
+	SSH SSHOptions
+	// GitHubApp configures GitHub App installation-token authentication, used
+	// automatically when populated and GitRepository is an HTTPS URL.
+	GitHubApp GitHubAppOptions
+
+	// Secrets configures resolution of ${VAR} compose references against a
+	// pluggable secrets backend before deploy.
+	Secrets SecretsOptions
+
+	// Sparse configures a partial checkout for monorepos holding many stacks.
+	Sparse SparseOptions
+	// RecurseSubmodules initializes and updates Git submodules after clone.
+	RecurseSubmodules bool
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/sled/compose-unpacker/metrics"
+)
+
+var errUpdateComposeFailure = errors.New("compose stack update failure")
+
+// UpdateCommand reconciles an existing clone created by DeployCommand against
+// its tracked reference or commit, then re-runs the Compose deployment so
+// Portainer can bring a stack up to date with the latest revision.
+type UpdateCommand struct {
+	GitRepository            string
+	User                     string
+	Password                 string
+	Destination              string
+	ComposeRelativeFilePaths []string
+	ProjectName              string
+	Reference                string
+	Commit                   string
+	MetricsAddr              string
+	TLS                      TLSOptions
+	SSH                      SSHOptions
+	GitHubApp                GitHubAppOptions
+	Secrets                  SecretsOptions
+}
+
+func (cmd *UpdateCommand) Run(cmdCtx *CommandExecutionContext) error {
+	start := time.Now()
+	defer func() {
+		metrics.DeployDurationSeconds.Observe(time.Since(start).Seconds())
+	}()
+
+	if cmd.MetricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(cmdCtx.context, cmd.MetricsAddr); err != nil {
+				cmdCtx.logger.Errorw("Metrics server stopped unexpectedly",
+					"error", err,
+				)
+			}
+		}()
+	}
+
+	opts := cmd.stackOptions()
+
+	cmdCtx.logger.Infow("Updating Compose stack from Git repository",
+		"repository", opts.GitRepository,
+		"composePath", opts.ComposeRelativeFilePaths,
+		"destination", opts.Destination,
+	)
+
+	if err := installTLSTransport(opts.TLS); err != nil {
+		cmdCtx.logger.Errorw("Failed to configure Git TLS transport",
+			"error", err,
+		)
+
+		return errUpdateComposeFailure
+	}
+
+	repositoryName, err := repositoryNameFromURL(opts.GitRepository)
+	if err != nil {
+		cmdCtx.logger.Errorw("Invalid Git repository URL",
+			"repository", opts.GitRepository,
+		)
+
+		return errUpdateComposeFailure
+	}
+	clonePath := joinClonePath(opts.Destination, repositoryName)
+
+	cmdCtx.logger.Infow("Opening existing git repository",
+		"path", clonePath,
+	)
+	repository, err := git.PlainOpen(clonePath)
+	if err != nil {
+		cmdCtx.logger.Errorw("Failed to open Git repository",
+			"error", err,
+		)
+
+		return errUpdateComposeFailure
+	}
+
+	cmdCtx.logger.Infow("Fetching git repository",
+		"path", clonePath,
+	)
+	hash, err := fetch(cmdCtx, repository, opts)
+	if err != nil {
+		cmdCtx.logger.Errorw("Failed to fetch and checkout Git repository",
+			"error", err,
+		)
+
+		return errUpdateComposeFailure
+	}
+
+	cmdCtx.logger.Infow("Resetting worktree to requested revision",
+		"reference", cmd.Reference,
+		"commit", cmd.Commit,
+		"resolved", hash.String(),
+	)
+
+	if err := deploy(cmdCtx, clonePath, opts); err != nil {
+		cmdCtx.logger.Errorw("Failed to deploy Compose stack",
+			"error", err,
+		)
+
+		return errUpdateComposeFailure
+	}
+
+	cmdCtx.logger.Info("Compose stack update complete")
+
+	return nil
+}
+
+func (cmd *UpdateCommand) stackOptions() stackOptions {
+	return stackOptions{
+		GitRepository:            cmd.GitRepository,
+		Destination:              cmd.Destination,
+		ComposeRelativeFilePaths: cmd.ComposeRelativeFilePaths,
+		ProjectName:              cmd.ProjectName,
+		Reference:                cmd.Reference,
+		Commit:                   cmd.Commit,
+		TLS:                      cmd.TLS,
+		Secrets:                  cmd.Secrets,
+		Auth: AuthOptions{
+			User:      cmd.User,
+			Password:  cmd.Password,
+			SSH:       cmd.SSH,
+			GitHubApp: cmd.GitHubApp,
+		},
+	}
+}
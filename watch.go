@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/sled/compose-unpacker/metrics"
+)
+
+var errWatchComposeFailure = errors.New("compose stack watch failure")
+
+// WatchCommand performs the initial clone+deploy of a stack and then polls
+// its tracked ref, redeploying whenever the remote head moves. It turns the
+// unpacker from a single-shot tool into a small GitOps reconciliation loop.
+type WatchCommand struct {
+	GitRepository            string
+	User                     string
+	Password                 string
+	Destination              string
+	ComposeRelativeFilePaths []string
+	ProjectName              string
+	Reference                string
+	Commit                   string
+	MetricsAddr              string
+	TLS                      TLSOptions
+	SSH                      SSHOptions
+	GitHubApp                GitHubAppOptions
+	Secrets                  SecretsOptions
+	Sparse                   SparseOptions
+	RecurseSubmodules        bool
+
+	// Interval is how often the tracked ref is polled for changes.
+	Interval time.Duration
+	// Jitter adds up to this much random delay to each poll, to avoid
+	// thundering-herd fetches when many stacks share an interval.
+	Jitter time.Duration
+	// WebhookAddr, when non-empty, starts an HTTP listener whose /reconcile
+	// endpoint triggers an immediate reconcile instead of waiting for the next
+	// poll.
+	WebhookAddr string
+}
+
+const (
+	watchBackoffInitial = 5 * time.Second
+	watchBackoffMax     = 5 * time.Minute
+)
+
+func (cmd *WatchCommand) Run(cmdCtx *CommandExecutionContext) error {
+	if cmd.MetricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(cmdCtx.context, cmd.MetricsAddr); err != nil {
+				cmdCtx.logger.Errorw("Metrics server stopped unexpectedly",
+					"error", err,
+				)
+			}
+		}()
+	}
+
+	opts := cmd.stackOptions()
+
+	cmdCtx.logger.Infow("Starting watch loop for Compose stack",
+		"repository", opts.GitRepository,
+		"interval", cmd.Interval,
+	)
+
+	clonePath, repository, cleanup, err := clone(cmdCtx, opts)
+	if err != nil {
+		cmdCtx.logger.Errorw("Failed initial clone of Git repository",
+			"error", err,
+		)
+
+		return errWatchComposeFailure
+	}
+	defer cleanup()
+
+	initialDeployStart := time.Now()
+	err = deploy(cmdCtx, clonePath, opts)
+	metrics.DeployDurationSeconds.Observe(time.Since(initialDeployStart).Seconds())
+	if err != nil {
+		cmdCtx.logger.Errorw("Failed initial deploy of Compose stack",
+			"error", err,
+		)
+
+		return errWatchComposeFailure
+	}
+
+	lastHash, err := repository.Head()
+	if err != nil {
+		cmdCtx.logger.Errorw("Failed to resolve HEAD after initial deploy",
+			"error", err,
+		)
+
+		return errWatchComposeFailure
+	}
+	currentHash := lastHash.Hash()
+
+	reconcile := make(chan struct{}, 1)
+	if cmd.WebhookAddr != "" {
+		go cmd.serveWebhook(cmdCtx, reconcile)
+	}
+
+	backoff := watchBackoffInitial
+	for {
+		select {
+		case <-cmdCtx.context.Done():
+			cmdCtx.logger.Info("Watch loop stopping, context cancelled")
+			return nil
+		case <-reconcile:
+			cmdCtx.logger.Info("Reconcile triggered by webhook")
+		case <-time.After(cmd.Interval + cmd.jitterDelay()):
+		}
+
+		newHash, err := fetch(cmdCtx, repository, opts)
+		if err != nil {
+			cmdCtx.logger.Errorw("Failed to fetch Git repository, backing off",
+				"error", err,
+				"backoff", backoff,
+			)
+
+			select {
+			case <-cmdCtx.context.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = watchBackoffInitial
+
+		if newHash == currentHash {
+			cmdCtx.logger.Infow("No change detected on tracked ref",
+				"commit", currentHash.String(),
+			)
+			continue
+		}
+
+		cmdCtx.logger.Infow("Detected new commit on tracked ref, redeploying",
+			"previous", currentHash.String(),
+			"current", newHash.String(),
+		)
+
+		redeployStart := time.Now()
+		err = deploy(cmdCtx, clonePath, opts)
+		metrics.DeployDurationSeconds.Observe(time.Since(redeployStart).Seconds())
+		if err != nil {
+			cmdCtx.logger.Errorw("Failed to redeploy Compose stack",
+				"error", err,
+			)
+			continue
+		}
+
+		currentHash = newHash
+	}
+}
+
+func (cmd *WatchCommand) jitterDelay() time.Duration {
+	if cmd.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(cmd.Jitter)))
+}
+
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > watchBackoffMax {
+		return watchBackoffMax
+	}
+	return next
+}
+
+// serveWebhook runs an HTTP listener that nudges the watch loop's reconcile
+// channel on every request to /reconcile, letting Portainer or a Git provider
+// webhook trigger an immediate fetch instead of waiting out the poll interval.
+// A nudge that arrives while another is still pending is dropped.
+func (cmd *WatchCommand) serveWebhook(cmdCtx *CommandExecutionContext, reconcile chan<- struct{}) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reconcile", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case reconcile <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "reconcile queued"})
+	})
+
+	server := &http.Server{Addr: cmd.WebhookAddr, Handler: mux}
+
+	go func() {
+		<-cmdCtx.context.Done()
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		cmdCtx.logger.Errorw("Webhook server stopped unexpectedly",
+			"error", err,
+		)
+	}
+}
+
+func (cmd *WatchCommand) stackOptions() stackOptions {
+	return stackOptions{
+		GitRepository:            cmd.GitRepository,
+		Destination:              cmd.Destination,
+		ComposeRelativeFilePaths: cmd.ComposeRelativeFilePaths,
+		ProjectName:              cmd.ProjectName,
+		Reference:                cmd.Reference,
+		Commit:                   cmd.Commit,
+		TLS:                      cmd.TLS,
+		Secrets:                  cmd.Secrets,
+		Sparse:                   cmd.Sparse,
+		RecurseSubmodules:        cmd.RecurseSubmodules,
+		Auth: AuthOptions{
+			User:      cmd.User,
+			Password:  cmd.Password,
+			SSH:       cmd.SSH,
+			GitHubApp: cmd.GitHubApp,
+		},
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		current time.Duration
+		want    time.Duration
+	}{
+		{watchBackoffInitial, 2 * watchBackoffInitial},
+		{watchBackoffMax / 2, watchBackoffMax},
+		{watchBackoffMax, watchBackoffMax},
+		{watchBackoffMax * 10, watchBackoffMax},
+	}
+
+	for _, tt := range tests {
+		if got := nextBackoff(tt.current); got != tt.want {
+			t.Errorf("nextBackoff(%v) = %v, want %v", tt.current, got, tt.want)
+		}
+	}
+}